@@ -6,15 +6,27 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
+	"flag"
 	"fmt"
 	"log"
 	"math/rand"
 	"net/http"
+	"os"
+	"os/signal"
 	"strconv"
 	"strings"
 	"sync"
+	"syscall"
 	"time"
+
+	"github.com/Rizzy1857/Apate/go-services/pkg/crowdsec"
+	"github.com/Rizzy1857/Apate/go-services/pkg/firehose"
+	"github.com/Rizzy1857/Apate/go-services/pkg/fleet"
+	"github.com/Rizzy1857/Apate/go-services/pkg/hkadvertise"
+	"github.com/Rizzy1857/Apate/go-services/pkg/obs"
+	"github.com/Rizzy1857/Apate/go-services/pkg/rtspd"
 )
 
 // DeviceInfo represents an IoT device
@@ -59,25 +71,373 @@ type Server struct {
 	startTime    time.Time
 	accessAttempts map[string][]time.Time
 	mutex        sync.RWMutex
+
+	rtsp *rtspd.Server
+
+	crowdsecClient *crowdsec.Client
+	bouncer        *crowdsec.Bouncer
+
+	hk *hkadvertise.Server
+
+	fleetCfgPath string
+	fleetSim     *fleet.Simulator
+	telemetry    map[string]*fleet.Telemetry
+
+	firehose *firehose.Hub
+
+	obs *obs.Observability
+}
+
+// rtspMountName returns the RTSP mount point a camera device is served on,
+// matching the stream_url handed out by cameraHandler.
+func rtspMountName(cameraID string) string {
+	return "stream/" + cameraID
+}
+
+// cameraLoopFile picks the sample stream a camera's mount loops. Per-device
+// overrides live in cameraLoopFiles; the fleet config (pkg/fleet) has no
+// loop-file setting, and applyFleetConfig gives every camera it adds
+// defaultLoopFile. It's
+// read from hkadvertise's own goroutine (via Server.LoopFile) and written
+// from applyFleetConfig on a SIGHUP reload, so both sides go through
+// cameraLoopFilesMu rather than Server.mutex, which cameraLoopFile has no
+// access to.
+func cameraLoopFile(cameraID string) string {
+	cameraLoopFilesMu.Lock()
+	defer cameraLoopFilesMu.Unlock()
+	if path, ok := cameraLoopFiles[cameraID]; ok {
+		return path
+	}
+	return defaultLoopFile
 }
 
-// NewServer creates a new IoT server instance
-func NewServer() *Server {
+func setCameraLoopFile(cameraID, path string) {
+	cameraLoopFilesMu.Lock()
+	defer cameraLoopFilesMu.Unlock()
+	cameraLoopFiles[cameraID] = path
+}
+
+// defaultLoopFile and cameraLoopFiles configure which sample elementary
+// stream rtspd loops for a camera that isn't otherwise overridden.
+var (
+	defaultLoopFile   = "assets/samples/default.h264"
+	cameraLoopFiles   = map[string]string{}
+	cameraLoopFilesMu sync.Mutex
+)
+
+// NewServer creates a new IoT server instance. configPath, if non-empty, is
+// a fleet YAML file (see pkg/fleet) describing extra cameras/sensors to
+// grow the honeynet with.
+func NewServer(configPath string) *Server {
 	server := &Server{
 		devices:        make(map[string]*DeviceInfo),
 		streams:        make(map[string]*CameraStream),
 		threats:        make([]ThreatEvent, 0),
 		startTime:      time.Now(),
 		accessAttempts: make(map[string][]time.Time),
+		fleetCfgPath:   configPath,
+		telemetry:      make(map[string]*fleet.Telemetry),
 	}
-	
+
 	// Initialize some fake devices
 	server.initializeDevices()
 	server.initializeStreams()
-	
+	server.initializeRTSP()
+	server.initializeCrowdSec()
+	server.initializeHomeKit()
+	server.initializeFleet()
+	server.initializeFirehose()
+	server.initializeObs()
+
 	return server
 }
 
+// initializeRTSP starts the RTSP/RTP subsystem and gives every security
+// camera device its own mount point so attackers who connect actually get
+// a stream instead of a dead socket.
+func (s *Server) initializeRTSP() {
+	s.rtsp = rtspd.NewServer(rtspd.Config{
+		ListenAddr:  ":554",
+		MaxSessions: 20,
+		BitrateKbps: 2048,
+	}, s)
+
+	for _, device := range s.devices {
+		if device.DeviceType != "security_camera" {
+			continue
+		}
+		s.rtsp.AddMount(rtspd.MountConfig{
+			Name:     rtspMountName(device.DeviceID),
+			LoopFile: cameraLoopFile(device.DeviceID),
+		})
+	}
+
+	if err := s.rtsp.Start(); err != nil {
+		log.Printf("rtspd: failed to start: %v", err)
+	}
+}
+
+// LogThreatEvent satisfies rtspd.ThreatLogger and hkadvertise.ThreatLogger
+// so the camera streaming and HomeKit subsystems can report into the same
+// threat pipeline as the HTTP handlers. Neither has an HTTP request to
+// hang a span off of, so these events aren't tied into an HTTP trace.
+func (s *Server) LogThreatEvent(sourceIP, eventType, description, severity string) {
+	s.logThreatEvent(context.Background(), sourceIP, eventType, description, severity)
+}
+
+// initializeCrowdSec wires up the optional CrowdSec LAPI integration. It's
+// disabled unless CROWDSEC_LAPI_URL is set, so the honeypot runs exactly as
+// before when no CrowdSec instance is configured.
+func (s *Server) initializeCrowdSec() {
+	lapiURL := os.Getenv("CROWDSEC_LAPI_URL")
+	if lapiURL == "" {
+		return
+	}
+
+	apiKey := os.Getenv("CROWDSEC_API_KEY")
+	tlsVerify := os.Getenv("CROWDSEC_TLS_INSECURE") == ""
+
+	s.crowdsecClient = crowdsec.NewClient(crowdsec.Config{
+		LAPIURL:         lapiURL,
+		APIKey:          apiKey,
+		TLSVerify:       tlsVerify,
+		ScenarioPrefix:  envOrDefault("CROWDSEC_SCENARIO_PREFIX", "apate"),
+		OfflineQueueDir: os.Getenv("CROWDSEC_OFFLINE_QUEUE_DIR"),
+	})
+	s.crowdsecClient.Start()
+
+	s.bouncer = crowdsec.NewBouncer(crowdsec.BouncerConfig{
+		LAPIURL:   lapiURL,
+		APIKey:    apiKey,
+		TLSVerify: tlsVerify,
+	})
+	if err := s.bouncer.Start(); err != nil {
+		log.Printf("crowdsec: bouncer failed to start: %v", err)
+	}
+}
+
+func envOrDefault(key, fallback string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return fallback
+}
+
+// initializeHomeKit advertises every security_camera device as a HomeKit
+// IP Camera accessory so scanners and smart-home apps probing for HomeKit
+// devices get a believable one to pair with.
+func (s *Server) initializeHomeKit() {
+	s.hk = hkadvertise.NewServer(hkadvertise.Config{
+		DataDir:   envOrDefault("HOMEKIT_DATA_DIR", "data/homekit"),
+		SetupCode: envOrDefault("HOMEKIT_SETUP_CODE", "031-45-154"),
+		BindAddr:  envOrDefault("HOMEKIT_BIND_ADDR", "192.168.1.101"),
+	}, s, s)
+
+	for _, device := range s.devices {
+		if device.DeviceType != "security_camera" {
+			continue
+		}
+		s.hk.AddDevice(hkadvertise.DeviceConfig{
+			DeviceID: device.DeviceID,
+			Name:     device.Model,
+			Model:    device.Model,
+		})
+	}
+
+	if err := s.hk.Start(); err != nil {
+		log.Printf("hkadvertise: failed to start: %v", err)
+	}
+}
+
+// LoopFile satisfies hkadvertise.StreamSource so a paired HomeKit peer that
+// starts a stream gets handed off to the same loop file rtspd serves for
+// that camera's mount.
+func (s *Server) LoopFile(cameraID string) string {
+	return cameraLoopFile(cameraID)
+}
+
+// initializeFleet gives every device a telemetry ring buffer and, if
+// --config points at a fleet YAML file, loads it and starts the liveness
+// simulator on top of the combined device set.
+func (s *Server) initializeFleet() {
+	s.mutex.Lock()
+	for id := range s.devices {
+		s.telemetry[id] = fleet.NewTelemetry(100)
+	}
+	s.mutex.Unlock()
+
+	if s.fleetCfgPath == "" {
+		return
+	}
+
+	cfg, err := fleet.LoadConfig(s.fleetCfgPath)
+	if err != nil {
+		log.Printf("fleet: %v", err)
+		return
+	}
+
+	s.applyFleetConfig(cfg)
+
+	s.fleetSim = fleet.NewSimulator(*cfg, s)
+	s.fleetSim.Start()
+}
+
+// reloadFleet re-reads the fleet YAML config, adding any newly defined
+// cameras/sensors to the running server. Triggered on SIGHUP so operators
+// can grow the honeynet without recompiling.
+func (s *Server) reloadFleet() {
+	if s.fleetCfgPath == "" {
+		log.Printf("fleet: no --config set, nothing to reload")
+		return
+	}
+	cfg, err := fleet.LoadConfig(s.fleetCfgPath)
+	if err != nil {
+		log.Printf("fleet: reload failed: %v", err)
+		return
+	}
+	s.applyFleetConfig(cfg)
+	log.Printf("fleet: reloaded config from %s", s.fleetCfgPath)
+}
+
+// applyFleetConfig adds any camera/sensor in cfg that isn't already a known
+// device, wiring new cameras up with their own rtspd mount.
+func (s *Server) applyFleetConfig(cfg *fleet.Config) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for id, streamURL := range cfg.Cameras {
+		if _, exists := s.devices[id]; exists {
+			continue
+		}
+		s.devices[id] = &DeviceInfo{
+			DeviceID:   id,
+			DeviceType: "security_camera",
+			Model:      "Fleet Camera",
+			Firmware:   pickFromPool(cfg.FirmwarePool, "v1.0.0"),
+			Status:     "online",
+			LastSeen:   time.Now(),
+			IPAddress:  streamURL,
+			MACAddress: randomMAC(cfg.MacOUIPool),
+		}
+		s.telemetry[id] = fleet.NewTelemetry(100)
+		if s.rtsp != nil {
+			setCameraLoopFile(id, defaultLoopFile)
+			s.rtsp.AddMount(rtspd.MountConfig{Name: rtspMountName(id), LoopFile: defaultLoopFile})
+		}
+	}
+
+	for id, sensorType := range cfg.Sensors {
+		if _, exists := s.devices[id]; exists {
+			continue
+		}
+		s.devices[id] = &DeviceInfo{
+			DeviceID:   id,
+			DeviceType: sensorType,
+			Model:      "Fleet Sensor",
+			Firmware:   pickFromPool(cfg.FirmwarePool, "v1.0.0"),
+			Status:     "online",
+			LastSeen:   time.Now(),
+			MACAddress: randomMAC(cfg.MacOUIPool),
+		}
+		s.telemetry[id] = fleet.NewTelemetry(100)
+	}
+}
+
+func pickFromPool(pool []string, fallback string) string {
+	if len(pool) == 0 {
+		return fallback
+	}
+	return pool[rand.Intn(len(pool))]
+}
+
+func randomMAC(ouiPool []string) string {
+	oui := pickFromPool(ouiPool, "aa:bb:cc")
+	return fmt.Sprintf("%s:%02x:%02x:%02x", oui, rand.Intn(256), rand.Intn(256), rand.Intn(256))
+}
+
+// DeviceIDs satisfies fleet.DeviceUpdater.
+func (s *Server) DeviceIDs() []string {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	ids := make([]string, 0, len(s.devices))
+	for id := range s.devices {
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+// ApplyTick satisfies fleet.DeviceUpdater, rolling one device's liveness
+// fields forward by a simulated tick.
+func (s *Server) ApplyTick(deviceID, status string, lastSeen time.Time, firmware string, uptimeDelta time.Duration) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	device, ok := s.devices[deviceID]
+	if !ok {
+		return
+	}
+	device.Status = status
+	device.LastSeen = lastSeen
+	device.Uptime += int64(uptimeDelta.Seconds())
+	if firmware != "" {
+		device.Firmware = firmware
+	}
+}
+
+// EmitTelemetry satisfies fleet.DeviceUpdater, recording a synthetic sensor
+// reading into a device's ring buffer.
+func (s *Server) EmitTelemetry(deviceID string, r fleet.Reading) {
+	s.mutex.RLock()
+	ring, ok := s.telemetry[deviceID]
+	s.mutex.RUnlock()
+	if !ok {
+		return
+	}
+	ring.Push(r)
+}
+
+// initializeFirehose starts the live threat-event fan-out hub that backs
+// /firehose and /firehose/sse.
+func (s *Server) initializeFirehose() {
+	s.firehose = firehose.NewHub(firehose.Config{
+		AuthToken: os.Getenv("FIREHOSE_AUTH_TOKEN"),
+	})
+	s.firehose.Start()
+}
+
+// initializeObs sets up OpenTelemetry tracing and Prometheus metrics.
+// Tracing only exports if OTEL_EXPORTER_OTLP_ENDPOINT is set; the metrics
+// admin listener only starts if METRICS_ADMIN_ADDR is set - both default
+// to off so the honeypot's deceptive surface never changes by itself.
+func (s *Server) initializeObs() {
+	o, err := obs.New(obs.Config{
+		OTLPEndpoint: os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT"),
+		OTLPInsecure: os.Getenv("OTEL_EXPORTER_OTLP_INSECURE") == "true",
+		MetricsAddr:  os.Getenv("METRICS_ADMIN_ADDR"),
+		ServiceName:  "apate-honeypot",
+	})
+	if err != nil {
+		log.Printf("obs: failed to initialize: %v", err)
+		return
+	}
+	s.obs = o
+
+	if s.rtsp != nil {
+		go s.sampleRTSPSessions()
+	}
+}
+
+// sampleRTSPSessions periodically copies rtspd's active session count into
+// the apate_active_rtsp_sessions gauge.
+func (s *Server) sampleRTSPSessions() {
+	ticker := time.NewTicker(5 * time.Second)
+	defer ticker.Stop()
+	for range ticker.C {
+		s.obs.Metrics.ActiveRTSPSessions.Set(float64(s.rtsp.ActiveSessions()))
+	}
+}
+
 // Initialize fake IoT devices
 func (s *Server) initializeDevices() {
 	devices := []DeviceInfo{
@@ -150,12 +510,12 @@ func (s *Server) initializeStreams() {
 }
 
 // Track access attempts for rate limiting and threat detection
-func (s *Server) trackAccess(ip string) bool {
+func (s *Server) trackAccess(ctx context.Context, ip string) bool {
 	s.mutex.Lock()
 	defer s.mutex.Unlock()
-	
+
 	now := time.Now()
-	
+
 	// Clean old attempts (older than 1 minute)
 	if attempts, exists := s.accessAttempts[ip]; exists {
 		var validAttempts []time.Time
@@ -166,24 +526,27 @@ func (s *Server) trackAccess(ip string) bool {
 		}
 		s.accessAttempts[ip] = validAttempts
 	}
-	
+
 	// Add current attempt
 	if s.accessAttempts[ip] == nil {
 		s.accessAttempts[ip] = make([]time.Time, 0)
 	}
 	s.accessAttempts[ip] = append(s.accessAttempts[ip], now)
-	
+
 	// Check if rate limit exceeded
 	if len(s.accessAttempts[ip]) > 10 {
-		s.logThreatEvent(ip, "rate_limit_exceeded", "Too many requests", "medium")
+		s.logThreatEvent(ctx, ip, "rate_limit_exceeded", "Too many requests", "medium")
+		if s.obs != nil {
+			s.obs.RecordRateLimited(ip)
+		}
 		return false
 	}
-	
+
 	return true
 }
 
 // Log threat events
-func (s *Server) logThreatEvent(sourceIP, eventType, description, severity string) {
+func (s *Server) logThreatEvent(ctx context.Context, sourceIP, eventType, description, severity string) {
 	event := ThreatEvent{
 		EventID:     fmt.Sprintf("evt_%d", time.Now().Unix()),
 		Timestamp:   time.Now(),
@@ -197,8 +560,44 @@ func (s *Server) logThreatEvent(sourceIP, eventType, description, severity strin
 	s.mutex.Lock()
 	s.threats = append(s.threats, event)
 	s.mutex.Unlock()
-	
+
 	log.Printf("THREAT EVENT: %s from %s - %s", eventType, sourceIP, description)
+
+	if s.crowdsecClient != nil {
+		s.crowdsecClient.Push(crowdsec.Event{
+			SourceIP:    sourceIP,
+			EventType:   eventType,
+			Description: description,
+			Severity:    severity,
+			Timestamp:   event.Timestamp,
+		})
+	}
+
+	if s.firehose != nil {
+		s.firehose.Publish(firehose.Event{
+			EventID:     event.EventID,
+			Timestamp:   event.Timestamp,
+			SourceIP:    sourceIP,
+			EventType:   eventType,
+			Description: description,
+			Severity:    severity,
+		})
+	}
+
+	if s.obs != nil {
+		s.obs.RecordThreatEvent(ctx, eventType, severity, description)
+	}
+}
+
+// route registers path behind both the honeypot's security middleware and,
+// whenever initializeObs succeeded, the observability layer - even with
+// neither tracing nor the metrics admin listener configured.
+func (s *Server) route(path string, handler http.HandlerFunc) {
+	wrapped := s.securityMiddleware(handler)
+	if s.obs != nil {
+		wrapped = s.obs.WrapHandler(path, wrapped)
+	}
+	http.HandleFunc(path, wrapped)
 }
 
 // Middleware for request logging and basic security
@@ -211,28 +610,45 @@ func (s *Server) securityMiddleware(next http.HandlerFunc) http.HandlerFunc {
 		
 		// Log request
 		log.Printf("Request: %s %s from %s", r.Method, r.URL.Path, clientIP)
-		
+
+		// Consult CrowdSec decisions before anything else gets to run
+		if s.bouncer != nil {
+			switch s.bouncer.Decide(clientIP) {
+			case crowdsec.DecisionBan:
+				s.logThreatEvent(r.Context(), clientIP, "crowdsec_banned", "Request blocked by CrowdSec decision", "high")
+				http.Error(w, "Forbidden", http.StatusForbidden)
+				return
+			case crowdsec.DecisionThrottle:
+				s.logThreatEvent(r.Context(), clientIP, "crowdsec_throttled", "Request throttled by CrowdSec decision", "medium")
+				time.Sleep(2 * time.Second)
+			case crowdsec.DecisionCaptcha:
+				s.logThreatEvent(r.Context(), clientIP, "crowdsec_captcha", "Serving decoy profile for CrowdSec captcha decision", "medium")
+				s.decoyHandler(w, r)
+				return
+			}
+		}
+
 		// Check rate limiting
-		if !s.trackAccess(clientIP) {
+		if !s.trackAccess(r.Context(), clientIP) {
 			http.Error(w, "Rate limit exceeded", http.StatusTooManyRequests)
 			return
 		}
-		
+
 		// Check for suspicious user agents
 		userAgent := r.Header.Get("User-Agent")
 		suspiciousAgents := []string{"curl", "wget", "python", "scanner", "bot", "nmap"}
 		for _, agent := range suspiciousAgents {
 			if strings.Contains(strings.ToLower(userAgent), agent) {
-				s.logThreatEvent(clientIP, "suspicious_user_agent", fmt.Sprintf("Suspicious user agent: %s", userAgent), "low")
+				s.logThreatEvent(r.Context(), clientIP, "suspicious_user_agent", fmt.Sprintf("Suspicious user agent: %s", userAgent), "low")
 				break
 			}
 		}
-		
+
 		// Check for common attack paths
 		suspiciousPaths := []string{"/admin", "/config", "/setup", "/.env", "/backup"}
 		for _, path := range suspiciousPaths {
 			if strings.Contains(strings.ToLower(r.URL.Path), path) {
-				s.logThreatEvent(clientIP, "suspicious_path_access", fmt.Sprintf("Access to suspicious path: %s", r.URL.Path), "medium")
+				s.logThreatEvent(r.Context(), clientIP, "suspicious_path_access", fmt.Sprintf("Access to suspicious path: %s", r.URL.Path), "medium")
 				break
 			}
 		}
@@ -246,6 +662,17 @@ func (s *Server) securityMiddleware(next http.HandlerFunc) http.HandlerFunc {
 	}
 }
 
+// decoyHandler serves a slower, deliberately sparse response for clients
+// CrowdSec has flagged for a captcha decision - enough to keep a scripted
+// client occupied without handing over anything a real handler would.
+func (s *Server) decoyHandler(w http.ResponseWriter, r *http.Request) {
+	time.Sleep(3 * time.Second)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status": "verifying",
+	})
+}
+
 // Root handler - device information
 func (s *Server) rootHandler(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
@@ -273,18 +700,20 @@ func (s *Server) cameraHandler(w http.ResponseWriter, r *http.Request) {
 	}
 	
 	// Check if device exists
+	s.mutex.RLock()
 	device, exists := s.devices[cameraID]
+	s.mutex.RUnlock()
 	if !exists {
 		http.Error(w, "Camera not found", http.StatusNotFound)
 		return
 	}
-	
+
 	// Simulate camera stream data
 	response := map[string]interface{}{
 		"camera_id":    device.DeviceID,
 		"model":        device.Model,
 		"status":       device.Status,
-		"stream_url":   fmt.Sprintf("rtsp://192.168.1.101:554/stream/%s", cameraID),
+		"stream_url":   fmt.Sprintf("rtsp://192.168.1.101:554/%s", rtspMountName(cameraID)),
 		"snapshot_url": fmt.Sprintf("http://192.168.1.101:8080/snapshot/%s.jpg", cameraID),
 		"resolution":   "1920x1080",
 		"fps":          30,
@@ -350,7 +779,7 @@ func (s *Server) streamHandler(w http.ResponseWriter, r *http.Request) {
 // Config endpoint (honeypot target)
 func (s *Server) configHandler(w http.ResponseWriter, r *http.Request) {
 	clientIP := strings.Split(r.RemoteAddr, ":")[0]
-	s.logThreatEvent(clientIP, "config_access_attempt", "Attempt to access configuration", "high")
+	s.logThreatEvent(r.Context(), clientIP, "config_access_attempt", "Attempt to access configuration", "high")
 	
 	// Return fake configuration that looks real but contains honeytokens
 	w.Header().Set("Content-Type", "application/json")
@@ -385,7 +814,7 @@ func (s *Server) configHandler(w http.ResponseWriter, r *http.Request) {
 // Admin endpoint (major honeypot target)
 func (s *Server) adminHandler(w http.ResponseWriter, r *http.Request) {
 	clientIP := strings.Split(r.RemoteAddr, ":")[0]
-	s.logThreatEvent(clientIP, "admin_access_attempt", "Attempt to access admin interface", "critical")
+	s.logThreatEvent(r.Context(), clientIP, "admin_access_attempt", "Attempt to access admin interface", "critical")
 	
 	w.Header().Set("Content-Type", "text/html")
 	
@@ -463,19 +892,56 @@ func (s *Server) threatsHandler(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(response)
 }
 
+// Per-device telemetry endpoint - /devices/{id}/telemetry
+func (s *Server) telemetryHandler(w http.ResponseWriter, r *http.Request) {
+	deviceID := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/devices/"), "/telemetry")
+	if deviceID == "" || !strings.HasSuffix(r.URL.Path, "/telemetry") {
+		http.NotFound(w, r)
+		return
+	}
+
+	s.mutex.RLock()
+	ring, ok := s.telemetry[deviceID]
+	s.mutex.RUnlock()
+	if !ok {
+		http.Error(w, "Device not found", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"device_id": deviceID,
+		"readings":  ring.Snapshot(),
+	})
+}
+
 func main() {
-	server := NewServer()
-	
-	// Set up routes with security middleware
-	http.HandleFunc("/", server.securityMiddleware(server.rootHandler))
-	http.HandleFunc("/camera", server.securityMiddleware(server.cameraHandler))
-	http.HandleFunc("/devices", server.securityMiddleware(server.devicesHandler))
-	http.HandleFunc("/stream", server.securityMiddleware(server.streamHandler))
-	http.HandleFunc("/config", server.securityMiddleware(server.configHandler))
-	http.HandleFunc("/admin", server.securityMiddleware(server.adminHandler))
-	http.HandleFunc("/status", server.securityMiddleware(server.statusHandler))
-	http.HandleFunc("/threats", server.securityMiddleware(server.threatsHandler))
-	
+	configPath := flag.String("config", "", "path to fleet YAML config (see pkg/fleet)")
+	flag.Parse()
+
+	server := NewServer(*configPath)
+
+	sighup := make(chan os.Signal, 1)
+	signal.Notify(sighup, syscall.SIGHUP)
+	go func() {
+		for range sighup {
+			server.reloadFleet()
+		}
+	}()
+
+	// Set up routes with the observability and security middleware layers
+	server.route("/", server.rootHandler)
+	server.route("/camera", server.cameraHandler)
+	server.route("/devices", server.devicesHandler)
+	server.route("/devices/", server.telemetryHandler)
+	server.route("/stream", server.streamHandler)
+	server.route("/config", server.configHandler)
+	server.route("/admin", server.adminHandler)
+	server.route("/status", server.statusHandler)
+	server.route("/threats", server.threatsHandler)
+	server.route("/firehose", server.firehose.ServeWS)
+	server.route("/firehose/sse", server.firehose.ServeSSE)
+
 	port := ":8081"
 	log.Printf("IoT Device Gateway starting on port %s", port)
 	log.Printf("Main endpoint: http://localhost%s/camera", port)
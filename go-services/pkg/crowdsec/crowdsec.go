@@ -0,0 +1,447 @@
+// Package crowdsec integrates the honeypot with a CrowdSec Local API (LAPI)
+// instance: threat events observed by the honeypot are pushed out as
+// signals, and ban/throttle/captcha decisions pulled from the community
+// blocklist are enforced back against incoming requests. Both halves are
+// optional - nothing is pushed or polled unless a Client or Bouncer is built
+// and started; neither skips its work when LAPIURL is empty.
+package crowdsec
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Event is the minimal threat information the honeypot hands to the
+// ingest side; it intentionally doesn't depend on the main package's
+// ThreatEvent type so this package stays importable on its own.
+type Event struct {
+	SourceIP    string
+	EventType   string
+	Description string
+	Severity    string
+	Timestamp   time.Time
+}
+
+// Config controls both the signal-push (ingest) and decision-pull
+// (enforcement) halves of the integration.
+type Config struct {
+	LAPIURL         string // e.g. "https://crowdsec.internal:8080"
+	APIKey          string // machine/bouncer API key
+	TLSVerify       bool   // false skips TLS certificate verification
+	ScenarioPrefix  string // e.g. "apate" -> "apate/admin_access_attempt"
+	BatchSize       int    // signals per push, default 20
+	BatchInterval   time.Duration
+	MaxRetries      int
+	OfflineQueueDir string // if set, signals are queued to disk when LAPI is unreachable
+}
+
+func (c *Config) setDefaults() {
+	if c.ScenarioPrefix == "" {
+		c.ScenarioPrefix = "apate"
+	}
+	if c.BatchSize <= 0 {
+		c.BatchSize = 20
+	}
+	if c.BatchInterval <= 0 {
+		c.BatchInterval = 10 * time.Second
+	}
+	if c.MaxRetries <= 0 {
+		c.MaxRetries = 5
+	}
+}
+
+func httpClient(tlsVerify bool) *http.Client {
+	return &http.Client{
+		Timeout: 10 * time.Second,
+		Transport: &http.Transport{
+			TLSClientConfig: &tls.Config{InsecureSkipVerify: !tlsVerify},
+		},
+	}
+}
+
+// severityConfidence maps the honeypot's coarse severity labels onto the
+// 0-100 confidence scale CrowdSec signals expect.
+var severityConfidence = map[string]int{
+	"low":      40,
+	"medium":   60,
+	"high":     80,
+	"critical": 95,
+}
+
+func confidenceFor(severity string) int {
+	if c, ok := severityConfidence[severity]; ok {
+		return c
+	}
+	return 50
+}
+
+// signal is a trimmed-down CrowdSec alert/signal payload - enough fields
+// for LAPI to score and redistribute the event, without pulling in the
+// full crowdsec-client Go SDK.
+type signal struct {
+	Scenario    string       `json:"scenario"`
+	Message     string       `json:"message"`
+	EventsCount int          `json:"events_count"`
+	StartAt     string       `json:"start_at"`
+	StopAt      string       `json:"stop_at"`
+	Confidence  int          `json:"confidence"`
+	Source      signalSource `json:"source"`
+}
+
+type signalSource struct {
+	Value string `json:"value"`
+	Scope string `json:"scope"`
+}
+
+func (c *Client) toSignal(ev Event) signal {
+	return signal{
+		Scenario:    fmt.Sprintf("%s/%s", c.cfg.ScenarioPrefix, ev.EventType),
+		Message:     ev.Description,
+		EventsCount: 1,
+		StartAt:     ev.Timestamp.UTC().Format(time.RFC3339),
+		StopAt:      ev.Timestamp.UTC().Format(time.RFC3339),
+		Confidence:  confidenceFor(ev.Severity),
+		Source: signalSource{
+			Value: ev.SourceIP,
+			Scope: "Ip",
+		},
+	}
+}
+
+// Client is the ingest side: it batches ThreatEvents into CrowdSec signals
+// and POSTs them to LAPI, retrying with backoff and falling back to an
+// on-disk queue when the LAPI is unreachable.
+type Client struct {
+	cfg  Config
+	http *http.Client
+
+	mu      sync.Mutex
+	pending []Event
+
+	events chan Event
+	done   chan struct{}
+	wg     sync.WaitGroup
+}
+
+// NewClient builds a Client. Call Start to begin batching and pushing.
+func NewClient(cfg Config) *Client {
+	cfg.setDefaults()
+	return &Client{
+		cfg:    cfg,
+		http:   httpClient(cfg.TLSVerify),
+		events: make(chan Event, 256),
+		done:   make(chan struct{}),
+	}
+}
+
+// Push enqueues an event for the next batch. It never blocks the caller -
+// logThreatEvent must stay fast even under a burst of traffic.
+func (c *Client) Push(ev Event) {
+	select {
+	case c.events <- ev:
+	default:
+		log.Printf("crowdsec: event queue full, dropping signal for %s", ev.SourceIP)
+	}
+}
+
+// Start launches the background batching/push loop.
+func (c *Client) Start() {
+	c.wg.Add(1)
+	go c.run()
+}
+
+// Close stops the batching loop, flushing any pending signals first.
+func (c *Client) Close() error {
+	close(c.done)
+	c.wg.Wait()
+	return nil
+}
+
+func (c *Client) run() {
+	defer c.wg.Done()
+	ticker := time.NewTicker(c.cfg.BatchInterval)
+	defer ticker.Stop()
+
+	var batch []Event
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		c.pushWithRetry(batch)
+		batch = nil
+	}
+
+	for {
+		select {
+		case ev := <-c.events:
+			batch = append(batch, ev)
+			if len(batch) >= c.cfg.BatchSize {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		case <-c.done:
+			flush()
+			return
+		}
+	}
+}
+
+func (c *Client) pushWithRetry(batch []Event) {
+	signals := make([]signal, len(batch))
+	for i, ev := range batch {
+		signals[i] = c.toSignal(ev)
+	}
+	body, err := json.Marshal(signals)
+	if err != nil {
+		log.Printf("crowdsec: marshal signals: %v", err)
+		return
+	}
+
+	backoff := time.Second
+	for attempt := 0; attempt < c.cfg.MaxRetries; attempt++ {
+		if c.postSignals(body) {
+			return
+		}
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+
+	log.Printf("crowdsec: giving up pushing %d signal(s) after %d attempts, queueing offline", len(batch), c.cfg.MaxRetries)
+	c.queueOffline(body)
+}
+
+func (c *Client) postSignals(body []byte) bool {
+	req, err := http.NewRequest(http.MethodPost, c.cfg.LAPIURL+"/v1/alerts", bytes.NewReader(body))
+	if err != nil {
+		return false
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Api-Key", c.cfg.APIKey)
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return false
+	}
+	defer resp.Body.Close()
+	return resp.StatusCode >= 200 && resp.StatusCode < 300
+}
+
+func (c *Client) queueOffline(body []byte) {
+	if c.cfg.OfflineQueueDir == "" {
+		return
+	}
+	if err := os.MkdirAll(c.cfg.OfflineQueueDir, 0o755); err != nil {
+		log.Printf("crowdsec: offline queue dir: %v", err)
+		return
+	}
+	name := filepath.Join(c.cfg.OfflineQueueDir, fmt.Sprintf("signals-%d.json", time.Now().UnixNano()))
+	if err := os.WriteFile(name, body, 0o644); err != nil {
+		log.Printf("crowdsec: write offline queue file: %v", err)
+	}
+}
+
+// Decision is the enforcement action a bouncer applies to a client IP.
+type Decision string
+
+const (
+	// DecisionNone means no matching decision was found; proceed normally.
+	DecisionNone Decision = ""
+	// DecisionBan rejects the request outright.
+	DecisionBan Decision = "ban"
+	// DecisionThrottle slows the response down rather than rejecting it.
+	DecisionThrottle Decision = "throttle"
+	// DecisionCaptcha serves a degraded decoy instead of the real handler.
+	DecisionCaptcha Decision = "captcha"
+)
+
+// decisionEntry is one parsed LAPI decision.
+type decisionEntry struct {
+	prefix netip.Prefix
+	kind   Decision
+}
+
+// BouncerConfig controls the decision-pull side of the integration.
+type BouncerConfig struct {
+	LAPIURL      string
+	APIKey       string
+	TLSVerify    bool
+	PollInterval time.Duration
+}
+
+func (c *BouncerConfig) setDefaults() {
+	if c.PollInterval <= 0 {
+		c.PollInterval = 10 * time.Second
+	}
+}
+
+// Bouncer polls LAPI's decision stream and keeps an in-memory set of
+// banned/throttled/captcha'd CIDR ranges that request handling can
+// consult without touching the network.
+type Bouncer struct {
+	cfg  BouncerConfig
+	http *http.Client
+
+	mu      sync.RWMutex
+	entries []decisionEntry
+
+	done chan struct{}
+	wg   sync.WaitGroup
+}
+
+// NewBouncer builds a Bouncer. Call Start to begin polling.
+func NewBouncer(cfg BouncerConfig) *Bouncer {
+	cfg.setDefaults()
+	return &Bouncer{
+		cfg:  cfg,
+		http: httpClient(cfg.TLSVerify),
+		done: make(chan struct{}),
+	}
+}
+
+// Start fetches the initial decision snapshot and launches the polling
+// loop that keeps it fresh.
+func (b *Bouncer) Start() error {
+	if err := b.poll(true); err != nil {
+		log.Printf("crowdsec: initial decision fetch failed: %v", err)
+	}
+
+	b.wg.Add(1)
+	go b.run()
+	return nil
+}
+
+// Close stops the polling loop.
+func (b *Bouncer) Close() error {
+	close(b.done)
+	b.wg.Wait()
+	return nil
+}
+
+func (b *Bouncer) run() {
+	defer b.wg.Done()
+	ticker := time.NewTicker(b.cfg.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if err := b.poll(false); err != nil {
+				log.Printf("crowdsec: decision poll failed: %v", err)
+			}
+		case <-b.done:
+			return
+		}
+	}
+}
+
+type decisionsStreamResponse struct {
+	New []struct {
+		Value    string `json:"value"`
+		Scope    string `json:"scope"`
+		Type     string `json:"type"`
+		Duration string `json:"duration"`
+	} `json:"new"`
+	Deleted []struct {
+		Value string `json:"value"`
+	} `json:"deleted"`
+}
+
+func (b *Bouncer) poll(startup bool) error {
+	url := fmt.Sprintf("%s/v1/decisions/stream?startup=%t", b.cfg.LAPIURL, startup)
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("X-Api-Key", b.cfg.APIKey)
+
+	resp, err := b.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("crowdsec: decisions stream returned %s", resp.Status)
+	}
+
+	var parsed decisionsStreamResponse
+	if err := json.NewDecoder(bufio.NewReader(resp.Body)).Decode(&parsed); err != nil {
+		return fmt.Errorf("crowdsec: decode decisions stream: %w", err)
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if startup {
+		b.entries = nil
+	}
+	for _, del := range parsed.Deleted {
+		b.removeLocked(del.Value)
+	}
+	for _, n := range parsed.New {
+		prefix, err := parseCIDROrIP(n.Value)
+		if err != nil {
+			continue
+		}
+		b.entries = append(b.entries, decisionEntry{prefix: prefix, kind: Decision(n.Type)})
+	}
+	// Longest prefix first so Decide's linear scan finds the most specific match.
+	sort.Slice(b.entries, func(i, j int) bool {
+		return b.entries[i].prefix.Bits() > b.entries[j].prefix.Bits()
+	})
+	return nil
+}
+
+func (b *Bouncer) removeLocked(value string) {
+	prefix, err := parseCIDROrIP(value)
+	if err != nil {
+		return
+	}
+	kept := b.entries[:0]
+	for _, e := range b.entries {
+		if e.prefix != prefix {
+			kept = append(kept, e)
+		}
+	}
+	b.entries = kept
+}
+
+func parseCIDROrIP(value string) (netip.Prefix, error) {
+	if prefix, err := netip.ParsePrefix(value); err == nil {
+		return prefix, nil
+	}
+	addr, err := netip.ParseAddr(value)
+	if err != nil {
+		return netip.Prefix{}, err
+	}
+	return netip.PrefixFrom(addr, addr.BitLen()), nil
+}
+
+// Decide returns the enforcement action for a client IP, or DecisionNone
+// if it matches no active decision.
+func (b *Bouncer) Decide(ip string) Decision {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return DecisionNone
+	}
+
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	for _, e := range b.entries {
+		if e.prefix.Contains(addr) {
+			return e.kind
+		}
+	}
+	return DecisionNone
+}
@@ -0,0 +1,364 @@
+// Package firehose fans out live ThreatEvents to subscribers over
+// WebSocket and Server-Sent Events, so a SOC integration can watch the
+// honeypot in real time instead of polling /threats. A single Hub goroutine
+// owns the subscriber set and a bounded replay history; publishing never
+// blocks the caller.
+package firehose
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// Event is the subset of threat information streamed to subscribers. It
+// intentionally doesn't depend on the main package's ThreatEvent type so
+// this package stays importable on its own.
+type Event struct {
+	EventID     string    `json:"event_id"`
+	Timestamp   time.Time `json:"timestamp"`
+	SourceIP    string    `json:"source_ip"`
+	EventType   string    `json:"event_type"`
+	Description string    `json:"description"`
+	Severity    string    `json:"severity"`
+}
+
+var severityRank = map[string]int{
+	"low":      1,
+	"medium":   2,
+	"high":     3,
+	"critical": 4,
+}
+
+// Filter is parsed once at subscribe time from query-string parameters.
+type Filter struct {
+	MinSeverity string
+	EventType   string
+	SourceCIDR  *net.IPNet
+}
+
+// Matches reports whether ev passes every configured filter.
+func (f Filter) Matches(ev Event) bool {
+	if f.MinSeverity != "" && severityRank[ev.Severity] < severityRank[f.MinSeverity] {
+		return false
+	}
+	if f.EventType != "" && ev.EventType != f.EventType {
+		return false
+	}
+	if f.SourceCIDR != nil {
+		ip := net.ParseIP(ev.SourceIP)
+		if ip == nil || !f.SourceCIDR.Contains(ip) {
+			return false
+		}
+	}
+	return true
+}
+
+func parseFilter(r *http.Request) Filter {
+	f := Filter{
+		MinSeverity: r.URL.Query().Get("min_severity"),
+		EventType:   r.URL.Query().Get("event_type"),
+	}
+	if cidr := r.URL.Query().Get("source_ip"); cidr != "" {
+		if !strings.Contains(cidr, "/") {
+			cidr += "/32"
+		}
+		if _, ipnet, err := net.ParseCIDR(cidr); err == nil {
+			f.SourceCIDR = ipnet
+		}
+	}
+	return f
+}
+
+// subscriber is one live WebSocket or SSE connection.
+type subscriber struct {
+	send   chan Event
+	filter Filter
+}
+
+// Config controls buffering, replay depth, and auth for the hub.
+type Config struct {
+	SubscriberBuffer int           // per-subscriber send buffer, default 32
+	HistorySize      int           // replayable event buffer, default 500
+	AuthToken        string        // required bearer token; empty disables auth
+	PingInterval     time.Duration // WebSocket keepalive ping, default 30s
+}
+
+func (c *Config) setDefaults() {
+	if c.SubscriberBuffer <= 0 {
+		c.SubscriberBuffer = 32
+	}
+	if c.HistorySize <= 0 {
+		c.HistorySize = 500
+	}
+	if c.PingInterval <= 0 {
+		c.PingInterval = 30 * time.Second
+	}
+}
+
+// Hub fans out published events to every matching subscriber and keeps a
+// bounded replay history for the `since` cursor.
+type Hub struct {
+	cfg Config
+
+	events     chan Event
+	register   chan *subscriber
+	unregister chan *subscriber
+
+	mu          sync.RWMutex
+	subscribers map[*subscriber]struct{}
+
+	historyMu sync.RWMutex
+	history   []Event
+
+	done chan struct{}
+	wg   sync.WaitGroup
+}
+
+// NewHub builds a Hub. Call Start to begin the fan-out loop.
+func NewHub(cfg Config) *Hub {
+	cfg.setDefaults()
+	return &Hub{
+		cfg:         cfg,
+		events:      make(chan Event, 256),
+		register:    make(chan *subscriber),
+		unregister:  make(chan *subscriber),
+		subscribers: make(map[*subscriber]struct{}),
+		done:        make(chan struct{}),
+	}
+}
+
+// Start launches the background fan-out loop.
+func (h *Hub) Start() {
+	h.wg.Add(1)
+	go h.run()
+}
+
+// Close stops the fan-out loop and disconnects every subscriber.
+func (h *Hub) Close() {
+	close(h.done)
+	h.wg.Wait()
+}
+
+// Publish enqueues ev for fan-out. It never blocks the caller - a logging
+// call site must stay fast even with a slow or absent hub.
+func (h *Hub) Publish(ev Event) {
+	select {
+	case h.events <- ev:
+	default:
+		log.Printf("firehose: event queue full, dropping %s", ev.EventID)
+	}
+}
+
+func (h *Hub) run() {
+	defer h.wg.Done()
+	for {
+		select {
+		case ev := <-h.events:
+			h.appendHistory(ev)
+			h.broadcast(ev)
+		case sub := <-h.register:
+			h.mu.Lock()
+			h.subscribers[sub] = struct{}{}
+			h.mu.Unlock()
+		case sub := <-h.unregister:
+			h.mu.Lock()
+			if _, ok := h.subscribers[sub]; ok {
+				delete(h.subscribers, sub)
+				close(sub.send)
+			}
+			h.mu.Unlock()
+		case <-h.done:
+			h.mu.Lock()
+			for sub := range h.subscribers {
+				delete(h.subscribers, sub)
+				close(sub.send)
+			}
+			h.mu.Unlock()
+			return
+		}
+	}
+}
+
+func (h *Hub) broadcast(ev Event) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	for sub := range h.subscribers {
+		if !sub.filter.Matches(ev) {
+			continue
+		}
+		select {
+		case sub.send <- ev:
+		default:
+			// Slow consumer: drop this event for this subscriber rather
+			// than block the whole hub.
+		}
+	}
+}
+
+func (h *Hub) appendHistory(ev Event) {
+	h.historyMu.Lock()
+	defer h.historyMu.Unlock()
+	h.history = append(h.history, ev)
+	if len(h.history) > h.cfg.HistorySize {
+		h.history = h.history[len(h.history)-h.cfg.HistorySize:]
+	}
+}
+
+// replaySince returns buffered events after sinceID, or every buffered
+// event if sinceID wasn't found (the cursor fell out the back of the
+// history window). An empty sinceID means no replay and returns nil.
+func (h *Hub) replaySince(sinceID string) []Event {
+	h.historyMu.RLock()
+	defer h.historyMu.RUnlock()
+
+	if sinceID == "" {
+		return nil
+	}
+	for i, ev := range h.history {
+		if ev.EventID == sinceID {
+			out := make([]Event, len(h.history)-i-1)
+			copy(out, h.history[i+1:])
+			return out
+		}
+	}
+	out := make([]Event, len(h.history))
+	copy(out, h.history)
+	return out
+}
+
+func (h *Hub) authorized(r *http.Request) bool {
+	if h.cfg.AuthToken == "" {
+		return true
+	}
+	return r.Header.Get("Authorization") == "Bearer "+h.cfg.AuthToken
+}
+
+var upgrader = websocket.Upgrader{
+	CheckOrigin: func(r *http.Request) bool { return true },
+}
+
+// ServeWS upgrades the request to a WebSocket and streams matching events
+// as JSON text frames until the client disconnects.
+func (h *Hub) ServeWS(w http.ResponseWriter, r *http.Request) {
+	if !h.authorized(r) {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	sub := &subscriber{send: make(chan Event, h.cfg.SubscriberBuffer), filter: parseFilter(r)}
+	h.register <- sub
+	defer func() { h.unregister <- sub }()
+
+	// Drain client frames on their own goroutine purely to notice when
+	// they close the connection; we don't expect them to send anything.
+	closed := make(chan struct{})
+	go func() {
+		defer close(closed)
+		for {
+			if _, _, err := conn.NextReader(); err != nil {
+				return
+			}
+		}
+	}()
+
+	for _, ev := range h.replaySince(r.URL.Query().Get("since")) {
+		if !sub.filter.Matches(ev) {
+			continue
+		}
+		if err := conn.WriteJSON(ev); err != nil {
+			return
+		}
+	}
+
+	ticker := time.NewTicker(h.cfg.PingInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case ev, ok := <-sub.send:
+			if !ok {
+				return
+			}
+			if err := conn.WriteJSON(ev); err != nil {
+				return
+			}
+		case <-ticker.C:
+			if err := conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+				return
+			}
+		case <-closed:
+			return
+		}
+	}
+}
+
+// ServeSSE streams matching events as text/event-stream, for curl-friendly
+// consumers that don't want a WebSocket client.
+func (h *Hub) ServeSSE(w http.ResponseWriter, r *http.Request) {
+	if !h.authorized(r) {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+
+	sub := &subscriber{send: make(chan Event, h.cfg.SubscriberBuffer), filter: parseFilter(r)}
+	h.register <- sub
+	defer func() { h.unregister <- sub }()
+
+	for _, ev := range h.replaySince(r.URL.Query().Get("since")) {
+		if !sub.filter.Matches(ev) {
+			continue
+		}
+		if !writeSSE(w, ev) {
+			return
+		}
+	}
+	flusher.Flush()
+
+	for {
+		select {
+		case ev, ok := <-sub.send:
+			if !ok {
+				return
+			}
+			if !writeSSE(w, ev) {
+				return
+			}
+			flusher.Flush()
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+func writeSSE(w http.ResponseWriter, ev Event) bool {
+	body, err := json.Marshal(ev)
+	if err != nil {
+		return true // skip a malformed event, don't kill the stream
+	}
+	_, err = fmt.Fprintf(w, "id: %s\ndata: %s\n\n", ev.EventID, body)
+	return err == nil
+}
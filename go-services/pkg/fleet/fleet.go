@@ -0,0 +1,264 @@
+// Package fleet loads a YAML-driven device inventory and runs a background
+// simulator that keeps each device's liveness state (LastSeen, Status,
+// Uptime, Firmware) drifting over time instead of sitting frozen at boot
+// values, plus a per-device ring buffer of synthetic sensor telemetry.
+package fleet
+
+import (
+	"fmt"
+	"math/rand"
+	"os"
+	"sync"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Config is the YAML-driven fleet definition, e.g.:
+//
+//	cameras:
+//	  cam-003: rtsp://192.168.1.103:554/stream/cam-003
+//	sensors:
+//	  sensor-002: humidity_sensor
+//	ping_interval_s: 30
+//	consecutive_down_threshold: 3
+//	firmware_pool: [v1.8.3, v1.8.4, v1.9.0]
+//	mac_oui_pool: [aa:bb:cc, d8:3a:dd]
+type Config struct {
+	Cameras                  map[string]string `yaml:"cameras"`
+	Sensors                  map[string]string `yaml:"sensors"`
+	PingIntervalS            int               `yaml:"ping_interval_s"`
+	ConsecutiveDownThreshold int               `yaml:"consecutive_down_threshold"`
+	FirmwarePool             []string          `yaml:"firmware_pool"`
+	MacOUIPool               []string          `yaml:"mac_oui_pool"`
+}
+
+func (c *Config) setDefaults() {
+	if c.PingIntervalS <= 0 {
+		c.PingIntervalS = 30
+	}
+	if c.ConsecutiveDownThreshold <= 0 {
+		c.ConsecutiveDownThreshold = 3
+	}
+}
+
+// LoadConfig reads and parses a fleet YAML file.
+func LoadConfig(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("fleet: read config %s: %w", path, err)
+	}
+
+	var cfg Config
+	if err := yaml.Unmarshal(data, &cfg); err != nil {
+		return nil, fmt.Errorf("fleet: parse config %s: %w", path, err)
+	}
+	cfg.setDefaults()
+	return &cfg, nil
+}
+
+// Reading is one synthetic sensor sample.
+type Reading struct {
+	Timestamp   time.Time `json:"timestamp"`
+	Temperature float64   `json:"temperature_c"`
+	Humidity    float64   `json:"humidity_pct"`
+	Motion      bool      `json:"motion"`
+}
+
+// Telemetry is a fixed-capacity ring buffer of Readings for one device.
+type Telemetry struct {
+	mu       sync.Mutex
+	readings []Reading
+	cap      int
+	next     int
+	filled   bool
+}
+
+// NewTelemetry builds a ring buffer holding up to capacity readings.
+func NewTelemetry(capacity int) *Telemetry {
+	if capacity <= 0 {
+		capacity = 100
+	}
+	return &Telemetry{readings: make([]Reading, capacity), cap: capacity}
+}
+
+// Push appends a reading, overwriting the oldest once the buffer is full.
+func (t *Telemetry) Push(r Reading) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.readings[t.next] = r
+	t.next = (t.next + 1) % t.cap
+	if t.next == 0 {
+		t.filled = true
+	}
+}
+
+// Snapshot returns the buffered readings oldest-first.
+func (t *Telemetry) Snapshot() []Reading {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if !t.filled {
+		out := make([]Reading, t.next)
+		copy(out, t.readings[:t.next])
+		return out
+	}
+	out := make([]Reading, t.cap)
+	copy(out, t.readings[t.next:])
+	copy(out[t.cap-t.next:], t.readings[:t.next])
+	return out
+}
+
+// DeviceUpdater is how the simulator reaches back into the honeypot's
+// device map without pkg/fleet depending on the main package's types.
+type DeviceUpdater interface {
+	// DeviceIDs returns every device the simulator should drive.
+	DeviceIDs() []string
+	// ApplyTick mutates one device's liveness fields for a simulation tick.
+	ApplyTick(deviceID, status string, lastSeen time.Time, firmware string, uptimeDelta time.Duration)
+	// EmitTelemetry records a synthetic sensor reading for a device.
+	EmitTelemetry(deviceID string, r Reading)
+}
+
+// statusState is the Markov chain's state space for device liveness.
+type statusState int
+
+const (
+	stateOnline statusState = iota
+	stateDegraded
+	stateOffline
+)
+
+func (s statusState) String() string {
+	switch s {
+	case stateDegraded:
+		return "degraded"
+	case stateOffline:
+		return "offline"
+	default:
+		return "online"
+	}
+}
+
+// transitions is the Markov model: from each state, the probability of
+// moving to stateOnline/stateDegraded/stateOffline on the next tick.
+var transitions = map[statusState][3]float64{
+	stateOnline:   {0.95, 0.05, 0.00},
+	stateDegraded: {0.60, 0.30, 0.10},
+	stateOffline:  {0.20, 0.30, 0.50},
+}
+
+func nextState(cur statusState) statusState {
+	probs := transitions[cur]
+	r := rand.Float64()
+	if r < probs[0] {
+		return stateOnline
+	}
+	if r < probs[0]+probs[1] {
+		return stateDegraded
+	}
+	return stateOffline
+}
+
+// deviceState tracks one device's raw Markov state alongside the status
+// actually reported to DeviceUpdater, which only follows the chain into a
+// down state once it has held for ConsecutiveDownThreshold ticks running -
+// debouncing single-tick flaps the same way a real health check would.
+type deviceState struct {
+	soft            statusState
+	reported        statusState
+	consecutiveDown int
+}
+
+// Simulator periodically mutates every device's liveness fields and emits
+// synthetic telemetry for every device, cameras included, via DeviceUpdater.
+type Simulator struct {
+	cfg     Config
+	updater DeviceUpdater
+
+	mu     sync.Mutex
+	states map[string]*deviceState
+
+	done chan struct{}
+	wg   sync.WaitGroup
+}
+
+// NewSimulator builds a Simulator. Call Start to begin ticking.
+func NewSimulator(cfg Config, updater DeviceUpdater) *Simulator {
+	cfg.setDefaults()
+	return &Simulator{
+		cfg:     cfg,
+		updater: updater,
+		states:  make(map[string]*deviceState),
+		done:    make(chan struct{}),
+	}
+}
+
+// Start launches the background tick loop.
+func (s *Simulator) Start() {
+	s.wg.Add(1)
+	go s.run()
+}
+
+// Stop ends the tick loop.
+func (s *Simulator) Stop() {
+	close(s.done)
+	s.wg.Wait()
+}
+
+func (s *Simulator) run() {
+	defer s.wg.Done()
+	interval := time.Duration(s.cfg.PingIntervalS) * time.Second
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			s.tick(interval)
+		case <-s.done:
+			return
+		}
+	}
+}
+
+func (s *Simulator) tick(elapsed time.Duration) {
+	now := time.Now()
+	for _, id := range s.updater.DeviceIDs() {
+		s.mu.Lock()
+		ds, ok := s.states[id]
+		if !ok {
+			ds = &deviceState{}
+			s.states[id] = ds
+		}
+		ds.soft = nextState(ds.soft)
+		if ds.soft == stateOnline {
+			ds.consecutiveDown = 0
+			ds.reported = stateOnline
+		} else {
+			ds.consecutiveDown++
+			if ds.consecutiveDown >= s.cfg.ConsecutiveDownThreshold {
+				ds.reported = ds.soft
+			}
+		}
+		reported := ds.reported
+		s.mu.Unlock()
+
+		firmware := ""
+		if len(s.cfg.FirmwarePool) > 0 && rand.Intn(20) == 0 { // occasional cloud update
+			firmware = s.cfg.FirmwarePool[rand.Intn(len(s.cfg.FirmwarePool))]
+		}
+
+		s.updater.ApplyTick(id, reported.String(), now, firmware, elapsed)
+		s.updater.EmitTelemetry(id, syntheticReading(now))
+	}
+}
+
+func syntheticReading(now time.Time) Reading {
+	return Reading{
+		Timestamp:   now,
+		Temperature: 18 + rand.Float64()*10,
+		Humidity:    30 + rand.Float64()*40,
+		Motion:      rand.Intn(10) == 0,
+	}
+}
@@ -0,0 +1,431 @@
+// Package hkadvertise publishes the honeypot's fake security cameras as
+// HomeKit IP Camera accessories over mDNS using the HAP protocol
+// (github.com/brutella/hap), so scanners and misconfigured smart-home apps
+// that go looking for HomeKit devices find something that answers.
+// Characteristic writes and stream setup requests are reported to the same
+// threat pipeline the HTTP and RTSP subsystems use, attributed to the
+// controller's real address; pairing completion is reported too, though
+// hap exposes no hook to attribute it to a peer (see watchPairing).
+package hkadvertise
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/brutella/hap"
+	"github.com/brutella/hap/accessory"
+	"github.com/brutella/hap/service"
+
+	"github.com/Rizzy1857/Apate/go-services/pkg/rtspd"
+)
+
+// ThreatLogger is the callback the honeypot's threat pipeline implements.
+// Mirrors rtspd.ThreatLogger so both subsystems report through the same
+// shape and one implementation satisfies both.
+type ThreatLogger interface {
+	LogThreatEvent(sourceIP, eventType, description, severity string)
+}
+
+// StreamSource hands a paired peer off to the RTSP/RTP subsystem so it
+// gets a plausible looped feed instead of a dead HomeKit session.
+type StreamSource interface {
+	// LoopFile returns the sample stream configured for a camera device,
+	// matching what the rtspd mount for that device serves.
+	LoopFile(deviceID string) string
+}
+
+// DeviceConfig describes one camera to advertise as a HomeKit accessory.
+type DeviceConfig struct {
+	DeviceID string
+	Name     string
+	Model    string
+}
+
+// Config controls the HomeKit advertisement server as a whole.
+type Config struct {
+	// DataDir persists the HAP key store (pairing state, long-term keys)
+	// across restarts, same as a real accessory would.
+	DataDir string
+	// SetupCode is the 8-digit pairing code shared across the fleet - real
+	// deployments of the same cheap camera model usually ship one too.
+	SetupCode string
+	// BindAddr is the LAN interface address the HAP server advertises
+	// itself on, e.g. "192.168.1.101".
+	BindAddr string
+	// StreamBitrateKbps paces the fake RTP feed handed off to a paired
+	// peer's negotiated endpoint. Defaults to 2048, matching rtspd's own
+	// default so both camera surfaces look the same on the wire.
+	StreamBitrateKbps int
+}
+
+func (c *Config) setDefaults() {
+	if c.StreamBitrateKbps <= 0 {
+		c.StreamBitrateKbps = 2048
+	}
+}
+
+// Server advertises a fleet of fake cameras as HomeKit accessories and
+// forwards pairing/streaming activity into the threat pipeline.
+type Server struct {
+	cfg    Config
+	logger ThreatLogger
+	source StreamSource
+
+	hap         *hap.Server
+	cancel      context.CancelFunc
+	accessories map[string]*accessory.Camera
+
+	mu            sync.Mutex
+	endpoints     map[string]*net.UDPAddr  // deviceID -> negotiated controller RTP endpoint
+	activeStreams map[string]*activeStream // deviceID -> running feed goroutine
+}
+
+// activeStream tracks one device's in-flight fake feed so a renegotiated
+// endpoint (or Server.Stop) can tear down the right goroutine.
+type activeStream struct {
+	stop chan struct{}
+	addr *net.UDPAddr
+}
+
+// NewServer builds an hkadvertise Server. Call AddDevice for every camera
+// before Start.
+func NewServer(cfg Config, logger ThreatLogger, source StreamSource) *Server {
+	cfg.setDefaults()
+	return &Server{
+		cfg:           cfg,
+		logger:        logger,
+		source:        source,
+		accessories:   make(map[string]*accessory.Camera),
+		endpoints:     make(map[string]*net.UDPAddr),
+		activeStreams: make(map[string]*activeStream),
+	}
+}
+
+// AddDevice registers a security_camera DeviceInfo as a HomeKit IP Camera
+// accessory with CameraRTPStreamManagement, Microphone, and Motion Sensor
+// services.
+func (s *Server) AddDevice(dev DeviceConfig) {
+	cam := accessory.NewCamera(accessory.Info{
+		Name:         dev.Name,
+		Manufacturer: "Apate",
+		Model:        dev.Model,
+		SerialNumber: dev.DeviceID,
+	})
+
+	// OnValueUpdate (rather than the typed OnValueRemoteUpdate wrapper) is
+	// used throughout so the http.Request - and with it the real peer
+	// address - is available to attribute the event to; req is nil for
+	// locally-initiated value changes, which these never are.
+	cam.StreamManagement1.StreamingStatus.OnValueUpdate(func(new, old []byte, req *http.Request) {
+		if req == nil {
+			return
+		}
+		s.logger.LogThreatEvent(peerAddr(req), "homekit_stream_status_write",
+			fmt.Sprintf("camera %s streaming status changed", dev.DeviceID), "low")
+	})
+	cam.StreamManagement1.SelectedRTPStreamConfiguration.OnValueUpdate(func(tlv, old []byte, req *http.Request) {
+		if req == nil {
+			return
+		}
+		s.handleSelectedStreamConfig(dev, tlv, peerAddr(req))
+	})
+	cam.StreamManagement1.SetupEndpoints.OnValueUpdate(func(tlv, old []byte, req *http.Request) {
+		if req == nil {
+			return
+		}
+		if addr, ok := decodeControllerEndpoint(tlv); ok {
+			s.mu.Lock()
+			s.endpoints[dev.DeviceID] = addr
+			s.mu.Unlock()
+		}
+		s.logger.LogThreatEvent(peerAddr(req), "homekit_stream_setup",
+			fmt.Sprintf("camera %s: peer requested RTP stream setup endpoints", dev.DeviceID), "high")
+	})
+
+	mic := service.NewMicrophone()
+	mic.Mute.OnValueUpdate(func(new, old bool, req *http.Request) {
+		if req == nil {
+			return
+		}
+		s.logger.LogThreatEvent(peerAddr(req), "homekit_mic_write",
+			fmt.Sprintf("camera %s microphone mute set to %v", dev.DeviceID, new), "low")
+	})
+	cam.AddS(mic.S)
+
+	// MotionDetected is read-only from the controller's side (no write hook
+	// to report on), but advertising the service still matters - a camera
+	// accessory missing it is itself a tell to a careful attacker.
+	motion := service.NewMotionSensor()
+	cam.AddS(motion.S)
+
+	s.accessories[dev.DeviceID] = cam
+}
+
+// Start builds the HAP server over every registered accessory and begins
+// advertising over mDNS.
+func (s *Server) Start() error {
+	store := hap.NewFsStore(s.cfg.DataDir)
+
+	var cams []*accessory.A
+	for _, cam := range s.accessories {
+		cams = append(cams, cam.A)
+	}
+	if len(cams) == 0 {
+		return fmt.Errorf("hkadvertise: no accessories registered")
+	}
+
+	bridge := accessory.NewBridge(accessory.Info{Name: "Apate Camera Bridge", Manufacturer: "Apate"})
+
+	srv, err := hap.NewServer(store, bridge.A, cams...)
+	if err != nil {
+		return fmt.Errorf("hkadvertise: new hap server: %w", err)
+	}
+	srv.Pin = s.cfg.SetupCode
+	srv.Addr = s.cfg.BindAddr
+
+	ctx, cancel := context.WithCancel(context.Background())
+	s.hap = srv
+	s.cancel = cancel
+
+	go func() {
+		if err := srv.ListenAndServe(ctx); err != nil && ctx.Err() == nil {
+			log.Printf("hkadvertise: server stopped: %v", err)
+		}
+	}()
+	go s.watchPairing(ctx)
+	return nil
+}
+
+// watchPairing reports when a controller completes HomeKit pairing.
+//
+// hap.Server (v0.0.35) handles /pair-setup and /pair-verify itself with
+// unexported handlers registered directly in hap.NewServer - there is no
+// public hook to observe an in-flight pairing attempt or its peer address,
+// so unlike every other event in this file, this can't be attributed to a
+// real source IP. Polling IsPaired for the unpaired->paired transition is
+// the best signal available short of vendoring hap's pairing handlers.
+func (s *Server) watchPairing(ctx context.Context) {
+	ticker := time.NewTicker(2 * time.Second)
+	defer ticker.Stop()
+
+	wasPaired := s.hap.IsPaired()
+	for {
+		select {
+		case <-ticker.C:
+			paired := s.hap.IsPaired()
+			if paired && !wasPaired {
+				s.logger.LogThreatEvent("homekit-lan-peer", "homekit_pairing_completed",
+					"a controller completed HomeKit pairing", "high")
+			}
+			wasPaired = paired
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// Stop tears down the HAP server and its mDNS advertisement, and stops any
+// in-flight fake feeds handed off to paired peers.
+func (s *Server) Stop() {
+	if s.cancel != nil {
+		s.cancel()
+	}
+
+	s.mu.Lock()
+	for id, as := range s.activeStreams {
+		close(as.stop)
+		delete(s.activeStreams, id)
+	}
+	s.mu.Unlock()
+}
+
+// handleSelectedStreamConfig decodes just enough of the
+// SelectedRTPStreamConfiguration TLV8 payload to log the attacker's intent,
+// then actually hands the session to rtspd's RTP packetizer so the
+// controller's negotiated endpoint receives the same looped feed rtspd
+// serves over RTSP, instead of a dead HomeKit session.
+func (s *Server) handleSelectedStreamConfig(dev DeviceConfig, tlv []byte, peer string) {
+	width, height, ssrc := decodeSelectedVideoParams(tlv)
+
+	s.logger.LogThreatEvent(peer, "homekit_stream_request",
+		fmt.Sprintf("camera %s: attacker requested %dx%d H.264 stream, ssrc=%d", dev.DeviceID, width, height, ssrc),
+		"high")
+
+	if s.source == nil {
+		return
+	}
+
+	s.mu.Lock()
+	addr, haveEndpoint := s.endpoints[dev.DeviceID]
+	if !haveEndpoint {
+		s.mu.Unlock()
+		log.Printf("hkadvertise: camera %s: no negotiated endpoint yet (SetupEndpoints not seen), can't stream", dev.DeviceID)
+		return
+	}
+	if existing, ok := s.activeStreams[dev.DeviceID]; ok {
+		if udpAddrEqual(existing.addr, addr) {
+			s.mu.Unlock()
+			return
+		}
+		// Controller renegotiated (e.g. ICE restart) to a new endpoint: tear
+		// down the stale feed before starting a new one, instead of leaving
+		// it running against an address the controller has moved on from.
+		close(existing.stop)
+		delete(s.activeStreams, dev.DeviceID)
+	}
+	stop := make(chan struct{})
+	s.activeStreams[dev.DeviceID] = &activeStream{stop: stop, addr: addr}
+	s.mu.Unlock()
+
+	loopFile := s.source.LoopFile(dev.DeviceID)
+	log.Printf("hkadvertise: camera %s streaming rtspd loop file %s to paired peer at %s", dev.DeviceID, loopFile, addr)
+
+	go func() {
+		defer func() {
+			s.mu.Lock()
+			if cur, ok := s.activeStreams[dev.DeviceID]; ok && cur.stop == stop {
+				delete(s.activeStreams, dev.DeviceID)
+			}
+			s.mu.Unlock()
+		}()
+		if err := rtspd.StreamLoopFileUDP(addr, loopFile, s.cfg.StreamBitrateKbps, stop); err != nil {
+			log.Printf("hkadvertise: camera %s: stream to %s failed: %v", dev.DeviceID, addr, err)
+		}
+	}()
+}
+
+// udpAddrEqual reports whether a and b are the same RTP endpoint. net.UDPAddr
+// isn't comparable with == since IP is a []byte slice.
+func udpAddrEqual(a, b *net.UDPAddr) bool {
+	return a.IP.Equal(b.IP) && a.Port == b.Port
+}
+
+// decodeSelectedVideoParams pulls width/height/ssrc out of a
+// SelectedRTPStreamConfiguration TLV8 blob on a best-effort basis - good
+// enough to log a believable intent, not a full HAP TLV8 implementation.
+func decodeSelectedVideoParams(tlv []byte) (width, height int, ssrc uint32) {
+	width, height = 1920, 1080 // HAP's default negotiated resolution
+	for i := 0; i+1 < len(tlv); {
+		tag, length := tlv[i], int(tlv[i+1])
+		i += 2
+		if i+length > len(tlv) {
+			break
+		}
+		value := tlv[i : i+length]
+		i += length
+
+		switch tag {
+		case 0x01: // video attributes sub-TLV: width(1)/height(2)/framerate(3)
+			w, h := decodeVideoAttributes(value)
+			if w > 0 && h > 0 {
+				width, height = w, h
+			}
+		case 0x03: // ssrc
+			ssrc = decodeUint32LE(value)
+		}
+	}
+	return width, height, ssrc
+}
+
+func decodeVideoAttributes(tlv []byte) (width, height int) {
+	for i := 0; i+1 < len(tlv); {
+		tag, length := tlv[i], int(tlv[i+1])
+		i += 2
+		if i+length > len(tlv) {
+			break
+		}
+		value := tlv[i : i+length]
+		i += length
+
+		switch tag {
+		case 0x01:
+			width = int(decodeUint32LE(value))
+		case 0x02:
+			height = int(decodeUint32LE(value))
+		}
+	}
+	return width, height
+}
+
+// decodeControllerEndpoint pulls the controller's RTP address out of a
+// SetupEndpoints TLV8 payload on a best-effort basis, matching the same
+// style and caveats as decodeSelectedVideoParams - not a full HAP TLV8
+// implementation, just enough to find where to send the fake feed.
+func decodeControllerEndpoint(tlv []byte) (*net.UDPAddr, bool) {
+	for i := 0; i+1 < len(tlv); {
+		tag, length := tlv[i], int(tlv[i+1])
+		i += 2
+		if i+length > len(tlv) {
+			break
+		}
+		value := tlv[i : i+length]
+		i += length
+
+		if tag != 0x03 { // controller address sub-TLV
+			continue
+		}
+
+		var ip string
+		var port int
+		for j := 0; j+1 < len(value); {
+			subTag, subLen := value[j], int(value[j+1])
+			j += 2
+			if j+subLen > len(value) {
+				break
+			}
+			subVal := value[j : j+subLen]
+			j += subLen
+
+			switch subTag {
+			case 0x02: // IP address, sent as its ASCII text form
+				ip = string(subVal)
+			case 0x03: // video RTP port
+				port = int(decodeUint16LE(subVal))
+			}
+		}
+
+		parsed := net.ParseIP(ip)
+		if parsed == nil || port == 0 {
+			return nil, false
+		}
+		return &net.UDPAddr{IP: parsed, Port: port}, true
+	}
+	return nil, false
+}
+
+func decodeUint16LE(b []byte) uint16 {
+	var v uint16
+	for i, by := range b {
+		if i >= 2 {
+			break
+		}
+		v |= uint16(by) << (8 * i)
+	}
+	return v
+}
+
+func decodeUint32LE(b []byte) uint32 {
+	var v uint32
+	for i, by := range b {
+		if i >= 4 {
+			break
+		}
+		v |= uint32(by) << (8 * i)
+	}
+	return v
+}
+
+// peerAddr extracts the controller's IP from a characteristic write
+// request, matching rtspd's use of net.SplitHostPort on conn.RemoteAddr().
+func peerAddr(req *http.Request) string {
+	host, _, err := net.SplitHostPort(req.RemoteAddr)
+	if err != nil {
+		return req.RemoteAddr
+	}
+	return host
+}
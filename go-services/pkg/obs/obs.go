@@ -0,0 +1,269 @@
+// Package obs wires OpenTelemetry tracing and Prometheus metrics across the
+// honeypot's HTTP handlers, so an operator can trace a full attacker
+// session - HTTP requests, RTSP sessions, threat events - and watch
+// aggregate load on a /metrics endpoint bound to a separate admin listener.
+package obs
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.24.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Config controls both halves of the observability layer. Tracing and the
+// metrics admin listener are each independently opt-in - a zero Config
+// does neither.
+type Config struct {
+	// OTLPEndpoint is the collector address, e.g. "otel-collector:4317".
+	// Empty disables tracing entirely.
+	OTLPEndpoint string
+	OTLPInsecure bool
+
+	// MetricsAddr, if set, starts a separate admin listener serving
+	// /metrics. Empty disables it - /metrics is never reachable on the
+	// honeypot's main listener.
+	MetricsAddr string
+
+	ServiceName string
+}
+
+// decoyRoutes marks which routes are the deceptive honeypot targets, for
+// the honeypot.decoy span attribute.
+var decoyRoutes = map[string]bool{
+	"/admin":  true,
+	"/config": true,
+}
+
+// Metrics bundles every Prometheus collector the middleware and handlers
+// report into.
+type Metrics struct {
+	RequestsTotal      *prometheus.CounterVec
+	ThreatEventsTotal  *prometheus.CounterVec
+	RateLimitedTotal   *prometheus.CounterVec
+	ActiveRTSPSessions prometheus.Gauge
+	RequestDuration    *prometheus.HistogramVec
+}
+
+func newMetrics() *Metrics {
+	m := &Metrics{
+		RequestsTotal: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "apate_requests_total",
+			Help: "Total HTTP requests handled, by route and status.",
+		}, []string{"route", "status"}),
+		ThreatEventsTotal: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "apate_threat_events_total",
+			Help: "Total threat events logged, by event type and severity.",
+		}, []string{"event_type", "severity"}),
+		RateLimitedTotal: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "apate_rate_limited_total",
+			Help: "Total requests rejected for rate limiting, by source IP /24 prefix.",
+		}, []string{"source_ip_prefix"}),
+		ActiveRTSPSessions: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "apate_active_rtsp_sessions",
+			Help: "Number of RTSP/RTP sessions currently streaming.",
+		}),
+		RequestDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "apate_request_duration_seconds",
+			Help:    "HTTP request duration in seconds, by route.",
+			Buckets: prometheus.DefBuckets,
+		}, []string{"route"}),
+	}
+
+	prometheus.MustRegister(m.RequestsTotal, m.ThreatEventsTotal, m.RateLimitedTotal, m.ActiveRTSPSessions, m.RequestDuration)
+	return m
+}
+
+// Observability bundles the tracer and metrics the rest of the honeypot
+// reports into, plus lifecycle management for both.
+type Observability struct {
+	cfg      Config
+	Tracer   trace.Tracer
+	Metrics  *Metrics
+	shutdown func(context.Context) error
+}
+
+// New sets up tracing (if OTLPEndpoint is set) and Prometheus collectors,
+// and starts the metrics admin listener (if MetricsAddr is set).
+func New(cfg Config) (*Observability, error) {
+	if cfg.ServiceName == "" {
+		cfg.ServiceName = "apate-honeypot"
+	}
+
+	o := &Observability{cfg: cfg, Metrics: newMetrics(), shutdown: func(context.Context) error { return nil }}
+
+	tracer, shutdown, err := initTracer(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("obs: init tracer: %w", err)
+	}
+	o.Tracer = tracer
+	o.shutdown = shutdown
+
+	if cfg.MetricsAddr != "" {
+		o.startMetricsListener()
+	}
+
+	return o, nil
+}
+
+func initTracer(cfg Config) (trace.Tracer, func(context.Context) error, error) {
+	if cfg.OTLPEndpoint == "" {
+		return otel.Tracer(cfg.ServiceName), func(context.Context) error { return nil }, nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	opts := []otlptracegrpc.Option{otlptracegrpc.WithEndpoint(cfg.OTLPEndpoint)}
+	if cfg.OTLPInsecure {
+		opts = append(opts, otlptracegrpc.WithInsecure())
+	}
+
+	exporter, err := otlptracegrpc.New(ctx, opts...)
+	if err != nil {
+		return nil, nil, fmt.Errorf("otlp exporter: %w", err)
+	}
+
+	res, err := resource.New(ctx, resource.WithAttributes(semconv.ServiceName(cfg.ServiceName)))
+	if err != nil {
+		return nil, nil, fmt.Errorf("resource: %w", err)
+	}
+
+	tp := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+	)
+	otel.SetTracerProvider(tp)
+
+	return tp.Tracer(cfg.ServiceName), tp.Shutdown, nil
+}
+
+// startMetricsListener binds /metrics to its own admin listener. Never
+// inherit the deceptive honeypot Server header here, and never mount it on
+// the main listener's mux - an operator's monitoring endpoint isn't part
+// of the deception surface.
+func (o *Observability) startMetricsListener() {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.Handler())
+
+	go func() {
+		log.Printf("obs: metrics admin listener on %s/metrics", o.cfg.MetricsAddr)
+		if err := http.ListenAndServe(o.cfg.MetricsAddr, mux); err != nil {
+			log.Printf("obs: metrics listener stopped: %v", err)
+		}
+	}()
+}
+
+// Shutdown flushes any pending spans and tears down the tracer provider.
+func (o *Observability) Shutdown(ctx context.Context) error {
+	return o.shutdown(ctx)
+}
+
+// WrapHandler starts a span for route, records request metrics, and calls
+// next - the shared middleware wrapper every handler goes through.
+func (o *Observability) WrapHandler(route string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+
+		ctx, span := o.Tracer.Start(r.Context(), route, trace.WithAttributes(
+			attribute.String("http.route", route),
+			attribute.String("client.ip", clientIP(r)),
+			attribute.Bool("honeypot.decoy", decoyRoutes[route]),
+		))
+		defer span.End()
+
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next(rec, r.WithContext(ctx))
+
+		duration := time.Since(start).Seconds()
+		status := fmt.Sprintf("%d", rec.status)
+
+		o.Metrics.RequestsTotal.WithLabelValues(route, status).Inc()
+		o.Metrics.RequestDuration.WithLabelValues(route).Observe(duration)
+		span.SetAttributes(attribute.Int("http.status_code", rec.status))
+	}
+}
+
+// RecordThreatEvent adds a span event for a ThreatEvent and increments the
+// threat-event counter, so a trace shows exactly when and why a session
+// got flagged.
+func (o *Observability) RecordThreatEvent(ctx context.Context, eventType, severity, description string) {
+	o.Metrics.ThreatEventsTotal.WithLabelValues(eventType, severity).Inc()
+
+	span := trace.SpanFromContext(ctx)
+	span.AddEvent("threat_event", trace.WithAttributes(
+		attribute.String("event_type", eventType),
+		attribute.String("severity", severity),
+		attribute.String("description", description),
+	))
+}
+
+// RecordRateLimited increments the rate-limited counter for a source IP's
+// /24 prefix, coarse enough not to leak individual attacker addresses into
+// metric cardinality.
+func (o *Observability) RecordRateLimited(sourceIP string) {
+	o.Metrics.RateLimitedTotal.WithLabelValues(prefix24(sourceIP)).Inc()
+}
+
+func prefix24(ip string) string {
+	var a, b, c, d int
+	if n, err := fmt.Sscanf(ip, "%d.%d.%d.%d", &a, &b, &c, &d); err == nil && n == 4 {
+		return fmt.Sprintf("%d.%d.%d.0/24", a, b, c)
+	}
+	return "unknown"
+}
+
+func clientIP(r *http.Request) string {
+	if fwd := r.Header.Get("X-Forwarded-For"); fwd != "" {
+		return fwd
+	}
+	return r.RemoteAddr
+}
+
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+// Unwrap lets http.ResponseController (and anything else using the Go 1.20+
+// unwrap convention) reach the underlying writer's optional interfaces.
+func (r *statusRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
+
+// Hijack forwards to the underlying writer so WrapHandler stays transparent
+// to handlers that need a raw connection - e.g. firehose's WebSocket
+// upgrade - instead of only implementing http.ResponseWriter.
+func (r *statusRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hj, ok := r.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, fmt.Errorf("obs: underlying ResponseWriter does not support Hijack")
+	}
+	return hj.Hijack()
+}
+
+// Flush forwards to the underlying writer so streaming handlers - e.g.
+// firehose's SSE stream - keep working through WrapHandler.
+func (r *statusRecorder) Flush() {
+	if f, ok := r.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
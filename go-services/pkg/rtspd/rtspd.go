@@ -0,0 +1,590 @@
+// Package rtspd implements a minimal RTSP/RTP server so that fake cameras
+// advertised over HTTP actually answer when something tries to pull their
+// stream. It speaks just enough of RFC 2326 (RTSP) and RFC 3550 (RTP) to
+// fool scanners and scripted attackers: OPTIONS/DESCRIBE/SETUP/PLAY/TEARDOWN,
+// an SDP offer with an H.264 video track (and optional AAC audio), and a
+// looped elementary stream played out over UDP or interleaved RTP-over-TCP.
+package rtspd
+
+import (
+	"bufio"
+	"encoding/base64"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ThreatLogger is the callback the honeypot's threat pipeline implements.
+// rtspd never talks to the rest of the honeypot directly so it can be
+// tested and reused without pulling in the HTTP server.
+type ThreatLogger interface {
+	LogThreatEvent(sourceIP, eventType, description, severity string)
+}
+
+// MountConfig describes one camera's RTSP mount point.
+type MountConfig struct {
+	// Name is the path segment attackers connect to, e.g. "stream/cam-001".
+	Name string
+	// LoopFile is the sample H.264 elementary stream (or MP4) played on
+	// repeat for every session against this mount.
+	LoopFile string
+	// BitrateKbps caps how fast the mount is allowed to push data; 0 means
+	// use the server-wide default.
+	BitrateKbps int
+}
+
+// Config controls the listener as a whole.
+type Config struct {
+	ListenAddr     string // e.g. ":554"
+	MaxSessions    int    // 0 means unlimited
+	BitrateKbps    int    // default per-session throttle
+	SessionTimeout time.Duration
+}
+
+// Server is the RTSP/RTP subsystem. One Server owns one TCP listener and a
+// registry of mounts; each mount corresponds to a DeviceInfo of type
+// security_camera on the honeypot.
+type Server struct {
+	cfg      Config
+	logger   ThreatLogger
+	listener net.Listener
+
+	mu     sync.RWMutex
+	mounts map[string]*MountConfig
+
+	sessions int32 // active session count, guarded via atomic
+
+	wg sync.WaitGroup
+}
+
+// NewServer builds an rtspd Server. Mounts can be added before or after
+// Start via AddMount.
+func NewServer(cfg Config, logger ThreatLogger) *Server {
+	if cfg.ListenAddr == "" {
+		cfg.ListenAddr = ":554"
+	}
+	if cfg.BitrateKbps <= 0 {
+		cfg.BitrateKbps = 2048
+	}
+	if cfg.SessionTimeout <= 0 {
+		cfg.SessionTimeout = 10 * time.Minute
+	}
+	return &Server{
+		cfg:    cfg,
+		logger: logger,
+		mounts: make(map[string]*MountConfig),
+	}
+}
+
+// AddMount registers (or replaces) the mount point for a camera device.
+func (s *Server) AddMount(mount MountConfig) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.mounts[mount.Name] = &mount
+}
+
+// Start opens the RTSP listener and begins accepting connections in the
+// background. Call Close to shut it down.
+func (s *Server) Start() error {
+	ln, err := net.Listen("tcp", s.cfg.ListenAddr)
+	if err != nil {
+		return fmt.Errorf("rtspd: listen %s: %w", s.cfg.ListenAddr, err)
+	}
+	s.listener = ln
+
+	s.wg.Add(1)
+	go s.acceptLoop()
+	return nil
+}
+
+// Close stops accepting new connections and waits for in-flight sessions
+// to notice and exit.
+func (s *Server) Close() error {
+	if s.listener == nil {
+		return nil
+	}
+	err := s.listener.Close()
+	s.wg.Wait()
+	return err
+}
+
+func (s *Server) acceptLoop() {
+	defer s.wg.Done()
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			sess := newSession(s, conn)
+			sess.serve()
+		}()
+	}
+}
+
+func (s *Server) mount(name string) (*MountConfig, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	m, ok := s.mounts[name]
+	return m, ok
+}
+
+// acquireSlot enforces Config.MaxSessions; a zero limit means unlimited.
+func (s *Server) acquireSlot() bool {
+	if s.cfg.MaxSessions <= 0 {
+		atomic.AddInt32(&s.sessions, 1)
+		return true
+	}
+	for {
+		cur := atomic.LoadInt32(&s.sessions)
+		if int(cur) >= s.cfg.MaxSessions {
+			return false
+		}
+		if atomic.CompareAndSwapInt32(&s.sessions, cur, cur+1) {
+			return true
+		}
+	}
+}
+
+func (s *Server) releaseSlot() {
+	atomic.AddInt32(&s.sessions, -1)
+}
+
+// ActiveSessions returns the number of RTSP sessions currently streaming.
+func (s *Server) ActiveSessions() int32 {
+	return atomic.LoadInt32(&s.sessions)
+}
+
+// session tracks one RTSP client from its first OPTIONS to TEARDOWN.
+type session struct {
+	srv    *Server
+	conn   net.Conn
+	reader *bufio.Reader
+	id     string
+	peerIP string
+
+	mountName   string
+	interleaved bool
+	rtpChannel  int
+	rtcpChannel int
+	clientAddr  *net.UDPAddr
+
+	playing  int32
+	stopPlay chan struct{}
+}
+
+func newSession(srv *Server, conn net.Conn) *session {
+	host, _, _ := net.SplitHostPort(conn.RemoteAddr().String())
+	return &session{
+		srv:      srv,
+		conn:     conn,
+		reader:   bufio.NewReader(conn),
+		id:       fmt.Sprintf("%d", time.Now().UnixNano()),
+		peerIP:   host,
+		stopPlay: make(chan struct{}),
+	}
+}
+
+func (sess *session) serve() {
+	defer sess.conn.Close()
+	defer sess.teardown()
+
+	for {
+		req, err := readRequest(sess.reader)
+		if err != nil {
+			return
+		}
+
+		switch req.method {
+		case "OPTIONS":
+			sess.handleOptions(req)
+		case "DESCRIBE":
+			sess.handleDescribe(req)
+		case "SETUP":
+			sess.handleSetup(req)
+		case "PLAY":
+			sess.handlePlay(req)
+		case "TEARDOWN":
+			sess.handleTeardown(req)
+			return
+		default:
+			sess.writeResponse(req, 501, "Not Implemented", nil, "")
+		}
+	}
+}
+
+type rtspRequest struct {
+	method  string
+	uri     string
+	headers map[string]string
+}
+
+func readRequest(r *bufio.Reader) (*rtspRequest, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	parts := strings.Fields(line)
+	if len(parts) < 2 {
+		return nil, fmt.Errorf("rtspd: malformed request line %q", line)
+	}
+	req := &rtspRequest{method: parts[0], uri: parts[1], headers: make(map[string]string)}
+
+	for {
+		hl, err := r.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		hl = strings.TrimRight(hl, "\r\n")
+		if hl == "" {
+			break
+		}
+		if idx := strings.Index(hl, ":"); idx > 0 {
+			key := strings.TrimSpace(hl[:idx])
+			val := strings.TrimSpace(hl[idx+1:])
+			req.headers[strings.ToLower(key)] = val
+		}
+	}
+	return req, nil
+}
+
+func (sess *session) writeResponse(req *rtspRequest, code int, status string, extra map[string]string, body string) {
+	var b strings.Builder
+	fmt.Fprintf(&b, "RTSP/1.0 %d %s\r\n", code, status)
+	fmt.Fprintf(&b, "CSeq: %s\r\n", req.headers["cseq"])
+	for k, v := range extra {
+		fmt.Fprintf(&b, "%s: %s\r\n", k, v)
+	}
+	if body != "" {
+		fmt.Fprintf(&b, "Content-Length: %d\r\n", len(body))
+	}
+	b.WriteString("\r\n")
+	b.WriteString(body)
+	sess.conn.Write([]byte(b.String()))
+}
+
+func (sess *session) mountNameFromURI(uri string) string {
+	// rtsp://host:554/stream/<id> -> "stream/<id>"
+	if idx := strings.Index(uri, "://"); idx >= 0 {
+		uri = uri[idx+3:]
+		if slash := strings.Index(uri, "/"); slash >= 0 {
+			uri = uri[slash+1:]
+		} else {
+			uri = ""
+		}
+	}
+	return strings.TrimSuffix(uri, "/")
+}
+
+// logAuth reports any Authorization header sent along with SETUP/PLAY so
+// credential-stuffing against the fake camera gets captured too.
+func (sess *session) logAuth(req *rtspRequest, verb string) {
+	auth := req.headers["authorization"]
+	if auth == "" {
+		return
+	}
+	desc := fmt.Sprintf("RTSP %s to %s with credentials: %s", verb, sess.mountName, decodeBasicAuth(auth))
+	sess.srv.logger.LogThreatEvent(sess.peerIP, "camera_auth_attempt", desc, "high")
+}
+
+func decodeBasicAuth(header string) string {
+	const prefix = "basic "
+	if len(header) <= len(prefix) || !strings.EqualFold(header[:len(prefix)], prefix) {
+		return header
+	}
+	decoded, err := base64.StdEncoding.DecodeString(header[len(prefix):])
+	if err != nil {
+		return header
+	}
+	return string(decoded)
+}
+
+func (sess *session) handleOptions(req *rtspRequest) {
+	sess.writeResponse(req, 200, "OK", map[string]string{
+		"Public": "OPTIONS, DESCRIBE, SETUP, PLAY, TEARDOWN",
+	}, "")
+}
+
+func (sess *session) handleDescribe(req *rtspRequest) {
+	name := sess.mountNameFromURI(req.uri)
+	mount, ok := sess.srv.mount(name)
+	if !ok {
+		sess.writeResponse(req, 404, "Not Found", nil, "")
+		return
+	}
+	sess.mountName = name
+
+	sdp := buildSDP(req.uri, mount)
+	sess.writeResponse(req, 200, "OK", map[string]string{
+		"Content-Type": "application/sdp",
+		"Session":      sess.id,
+	}, sdp)
+}
+
+func buildSDP(uri string, mount *MountConfig) string {
+	var b strings.Builder
+	b.WriteString("v=0\r\n")
+	fmt.Fprintf(&b, "o=- %d %d IN IP4 0.0.0.0\r\n", time.Now().Unix(), time.Now().Unix())
+	b.WriteString("s=Apate Camera Stream\r\n")
+	fmt.Fprintf(&b, "a=control:%s\r\n", uri)
+	b.WriteString("t=0 0\r\n")
+	b.WriteString("m=video 0 RTP/AVP 96\r\n")
+	b.WriteString("a=rtpmap:96 H264/90000\r\n")
+	b.WriteString("a=control:trackID=0\r\n")
+	if mount.LoopFile != "" && hasAudioTrack(mount.LoopFile) {
+		b.WriteString("m=audio 0 RTP/AVP 97\r\n")
+		b.WriteString("a=rtpmap:97 MPEG4-GENERIC/44100/2\r\n")
+		b.WriteString("a=control:trackID=1\r\n")
+	}
+	return b.String()
+}
+
+// hasAudioTrack is a cheap heuristic: we only bother advertising an audio
+// track when an ".mp4" loop file is configured, since our bare ".h264"
+// elementary streams never carry audio.
+func hasAudioTrack(loopFile string) bool {
+	return strings.HasSuffix(strings.ToLower(loopFile), ".mp4")
+}
+
+func (sess *session) handleSetup(req *rtspRequest) {
+	name := sess.mountNameFromURI(req.uri)
+	if sess.mountName == "" {
+		// buildSDP advertises "trackID=0"; clients may echo it in any case.
+		if strings.HasSuffix(strings.ToLower(name), "/trackid=0") {
+			name = name[:len(name)-len("/trackid=0")]
+		}
+		sess.mountName = name
+	}
+	if _, ok := sess.srv.mount(sess.mountName); !ok {
+		sess.writeResponse(req, 404, "Not Found", nil, "")
+		return
+	}
+
+	sess.logAuth(req, "SETUP")
+
+	transport := req.headers["transport"]
+	resp := map[string]string{"Session": sess.id}
+
+	switch {
+	case strings.Contains(transport, "interleaved"):
+		ch0, ch1 := parseInterleaved(transport)
+		sess.interleaved = true
+		sess.rtpChannel, sess.rtcpChannel = ch0, ch1
+		resp["Transport"] = fmt.Sprintf("RTP/AVP/TCP;interleaved=%d-%d", ch0, ch1)
+	default:
+		clientPort := parseClientPort(transport)
+		host, _, _ := net.SplitHostPort(sess.conn.RemoteAddr().String())
+		sess.clientAddr = &net.UDPAddr{IP: net.ParseIP(host), Port: clientPort}
+		resp["Transport"] = fmt.Sprintf("RTP/AVP;unicast;client_port=%d-%d;server_port=6970-6971", clientPort, clientPort+1)
+	}
+
+	sess.srv.logger.LogThreatEvent(sess.peerIP, "camera_stream_setup",
+		fmt.Sprintf("SETUP on mount %s, transport=%s", sess.mountName, transport), "medium")
+
+	sess.writeResponse(req, 200, "OK", resp, "")
+}
+
+func parseInterleaved(transport string) (int, int) {
+	for _, part := range strings.Split(transport, ";") {
+		if strings.HasPrefix(part, "interleaved=") {
+			bounds := strings.TrimPrefix(part, "interleaved=")
+			pair := strings.Split(bounds, "-")
+			a, _ := strconv.Atoi(pair[0])
+			b := a + 1
+			if len(pair) > 1 {
+				b, _ = strconv.Atoi(pair[1])
+			}
+			return a, b
+		}
+	}
+	return 0, 1
+}
+
+func parseClientPort(transport string) int {
+	for _, part := range strings.Split(transport, ";") {
+		if strings.HasPrefix(part, "client_port=") {
+			bounds := strings.TrimPrefix(part, "client_port=")
+			port, _ := strconv.Atoi(strings.Split(bounds, "-")[0])
+			return port
+		}
+	}
+	return 0
+}
+
+func (sess *session) handlePlay(req *rtspRequest) {
+	mount, ok := sess.srv.mount(sess.mountName)
+	if !ok {
+		sess.writeResponse(req, 454, "Session Not Found", nil, "")
+		return
+	}
+
+	sess.logAuth(req, "PLAY")
+
+	if !atomic.CompareAndSwapInt32(&sess.playing, 0, 1) {
+		// Already streaming: a repeated PLAY on the same session must be
+		// idempotent rather than acquire another slot, since only the
+		// first PLAY's slot is ever released by teardown.
+		sess.writeResponse(req, 200, "OK", map[string]string{
+			"Session": sess.id,
+			"Range":   "npt=0.000-",
+		}, "")
+		return
+	}
+
+	if !sess.srv.acquireSlot() {
+		atomic.StoreInt32(&sess.playing, 0)
+		sess.writeResponse(req, 453, "Not Enough Bandwidth", nil, "")
+		sess.srv.logger.LogThreatEvent(sess.peerIP, "camera_session_rejected",
+			fmt.Sprintf("PLAY on %s rejected: max concurrent sessions reached", sess.mountName), "low")
+		return
+	}
+
+	sess.srv.logger.LogThreatEvent(sess.peerIP, "camera_stream_play",
+		fmt.Sprintf("PLAY started on mount %s", sess.mountName), "high")
+
+	sess.writeResponse(req, 200, "OK", map[string]string{
+		"Session": sess.id,
+		"Range":   "npt=0.000-",
+	}, "")
+
+	bitrate := mount.BitrateKbps
+	if bitrate <= 0 {
+		bitrate = sess.srv.cfg.BitrateKbps
+	}
+	go sess.stream(mount.LoopFile, bitrate)
+}
+
+func (sess *session) handleTeardown(req *rtspRequest) {
+	sess.srv.logger.LogThreatEvent(sess.peerIP, "camera_stream_teardown",
+		fmt.Sprintf("TEARDOWN on mount %s", sess.mountName), "low")
+	sess.writeResponse(req, 200, "OK", map[string]string{"Session": sess.id}, "")
+}
+
+func (sess *session) teardown() {
+	if atomic.LoadInt32(&sess.playing) == 1 {
+		close(sess.stopPlay)
+		sess.srv.releaseSlot()
+	}
+}
+
+// stream loops the sample file out over RTP, throttled to bitrateKbps.
+// Packets never leave valid RTP framing even though the payload is just a
+// slice of the loop file - good enough to keep a scripted client happy.
+func (sess *session) stream(loopFile string, bitrateKbps int) {
+	var udpConn *net.UDPConn
+	if !sess.interleaved && sess.clientAddr != nil {
+		udpConn, _ = net.DialUDP("udp", nil, sess.clientAddr)
+	}
+
+	streamRTP(loopFile, bitrateKbps, sess.stopPlay, func(pkt []byte) bool {
+		if sess.interleaved {
+			frame := append([]byte{'$', byte(sess.rtpChannel), byte(len(pkt) >> 8), byte(len(pkt))}, pkt...)
+			_, err := sess.conn.Write(frame)
+			return err == nil
+		}
+		if udpConn == nil {
+			return false
+		}
+		_, err := udpConn.Write(pkt)
+		return err == nil
+	})
+}
+
+// StreamLoopFileUDP loops loopFile out over RTP to addr via UDP until stop
+// is closed or the connection errors. It's the same fake-feed packetizer
+// session.stream uses for RTSP PLAY, exported so other fake-camera surfaces
+// (e.g. hkadvertise's HomeKit stream handoff) serve an identical feed
+// instead of reimplementing RTP framing.
+func StreamLoopFileUDP(addr *net.UDPAddr, loopFile string, bitrateKbps int, stop <-chan struct{}) error {
+	conn, err := net.DialUDP("udp", nil, addr)
+	if err != nil {
+		return fmt.Errorf("rtspd: dial %s: %w", addr, err)
+	}
+	defer conn.Close()
+
+	streamRTP(loopFile, bitrateKbps, stop, func(pkt []byte) bool {
+		_, err := conn.Write(pkt)
+		return err == nil
+	})
+	return nil
+}
+
+// streamRTP paces loopFile out as RTP packets at bitrateKbps, handing each
+// packet to send until stop is closed or send reports failure.
+func streamRTP(loopFile string, bitrateKbps int, stop <-chan struct{}, send func(pkt []byte) bool) {
+	const payloadSize = 1400
+	packetsPerSecond := (bitrateKbps * 1000 / 8) / payloadSize
+	if packetsPerSecond <= 0 {
+		packetsPerSecond = 1
+	}
+	interval := time.Second / time.Duration(packetsPerSecond)
+
+	data := readLoopFile(loopFile)
+	if len(data) == 0 {
+		data = make([]byte, payloadSize) // nothing configured: stream silence
+	}
+
+	var seq uint16
+	var ts uint32
+	offset := 0
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			end := offset + payloadSize
+			var chunk []byte
+			if end >= len(data) {
+				chunk = append(append([]byte{}, data[offset:]...), data[:end-len(data)]...)
+				offset = end - len(data)
+			} else {
+				chunk = data[offset:end]
+				offset = end
+			}
+
+			pkt := encodeRTPPacket(96, seq, ts, chunk)
+			seq++
+			ts += 3000
+
+			if !send(pkt) {
+				return
+			}
+		}
+	}
+}
+
+func readLoopFile(path string) []byte {
+	if path == "" {
+		return nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil
+	}
+	return data
+}
+
+func encodeRTPPacket(payloadType byte, seq uint16, ts uint32, payload []byte) []byte {
+	header := make([]byte, 12)
+	header[0] = 0x80 // version 2
+	header[1] = payloadType & 0x7f
+	header[2] = byte(seq >> 8)
+	header[3] = byte(seq)
+	header[4] = byte(ts >> 24)
+	header[5] = byte(ts >> 16)
+	header[6] = byte(ts >> 8)
+	header[7] = byte(ts)
+	// ssrc is fixed; we're not multiplexing multiple logical sources.
+	header[8], header[9], header[10], header[11] = 0xde, 0xad, 0xbe, 0xef
+	return append(header, payload...)
+}